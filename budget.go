@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"regexp"
+	sortPkg "sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// sizeBudgets maps a resize target (in pixels) to the maximum number of
+// bytes an encoded image at that size may occupy, per IMAGE_SIZE_BUDGETS.
+var sizeBudgets = mustParseSizeBudgets(mustGetEnvString("IMAGE_SIZE_BUDGETS", "28=25KB,56=50KB,112=100KB,256=500KB,320=1MB"))
+
+var sizeBudgetPairSplitter = regexp.MustCompile(`\s*,\s*`)
+var byteSizePattern = regexp.MustCompile(`(?i)^(\d+)\s*(b|kb|mb)?$`)
+
+func parseByteSize(s string) (int, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(m[2]) {
+	case "mb":
+		return n * 1024 * 1024, nil
+	case "kb":
+		return n * 1024, nil
+	default: // "b" or no unit
+		return n, nil
+	}
+}
+
+// parseSizeBudgets parses a comma-separated "size=budget" list such as
+// "28=25KB,56=50KB,112=100KB,256=500KB,320=1MB".
+func parseSizeBudgets(spec string) (map[int]int, error) {
+	budgets := make(map[int]int)
+	for _, pair := range sizeBudgetPairSplitter.Split(spec, -1) {
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid size budget entry %q", pair)
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in budget entry %q: %w", pair, err)
+		}
+		budget, err := parseByteSize(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget in entry %q: %w", pair, err)
+		}
+		budgets[size] = budget
+	}
+	return budgets, nil
+}
+
+func mustParseSizeBudgets(spec string) map[int]int {
+	budgets, err := parseSizeBudgets(spec)
+	if err != nil {
+		panic(err)
+	}
+	return budgets
+}
+
+// fitBudget shrinks imgBytes (encoded as format, either "png" or "gif") until
+// it fits the byte budget configured for size, returning the possibly
+// re-encoded bytes and a short description of the strategy that got it
+// there. If size has no configured budget, or imgBytes already fits, it is
+// returned unchanged with strategy "none".
+func fitBudget(imgBytes []byte, format string, size int) ([]byte, string, error) {
+	budget, ok := sizeBudgets[size]
+	if !ok || budget <= 0 || len(imgBytes) <= budget {
+		return imgBytes, "none", nil
+	}
+
+	switch format {
+	case "png":
+		return fitPNGBudget(imgBytes, budget)
+	case "gif":
+		return fitGIFBudget(imgBytes, budget)
+	default:
+		return imgBytes, "none", nil
+	}
+}
+
+func fitPNGBudget(imgBytes []byte, budget int) ([]byte, string, error) {
+	img, err := png.Decode(bytes.NewReader(imgBytes))
+	if err != nil {
+		return nil, "", err
+	}
+
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	best := append([]byte(nil), buf.Bytes()...)
+	strategy := "png-best-compression"
+	if buf.Len() <= budget {
+		return best, strategy, nil
+	}
+
+	for _, numColors := range []int{256, 128, 64} {
+		pal := medianCutPalette(img, numColors)
+		paletted := image.NewPaletted(img.Bounds(), pal)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, image.Point{})
+
+		buf.Reset()
+		if err := enc.Encode(&buf, paletted); err != nil {
+			return nil, "", err
+		}
+		best = append([]byte(nil), buf.Bytes()...)
+		strategy = fmt.Sprintf("png-palette-%d", numColors)
+		if buf.Len() <= budget {
+			break
+		}
+	}
+
+	return best, strategy, nil
+}
+
+func fitGIFBudget(imgBytes []byte, budget int) ([]byte, string, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(imgBytes))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var best []byte
+	strategy := "none"
+
+	for _, stride := range []int{1, 2, 3, 4} {
+		for _, numColors := range []int{256, 128, 64} {
+			candidate := reencodeGIFFrames(g, stride, numColors)
+
+			var buf bytes.Buffer
+			if err := encodeGIF(&buf, candidate); err != nil {
+				return nil, "", err
+			}
+			best = append([]byte(nil), buf.Bytes()...)
+			strategy = fmt.Sprintf("gif-stride-%d-palette-%d", stride, numColors)
+			if buf.Len() <= budget {
+				return best, strategy, nil
+			}
+		}
+	}
+
+	// Last resort: one shared global palette across every kept frame,
+	// instead of quantizing each frame independently.
+	dropped := reencodeGIFFrames(g, 4, 256)
+	globalEncoded, err := encodeGIFGlobalPalette(dropped)
+	if err == nil {
+		best = globalEncoded
+		strategy = "gif-global-palette"
+	}
+
+	return best, strategy, nil
+}
+
+// reencodeGIFFrames keeps every stride-th frame (merging the dropped frames'
+// delays into the kept one) and re-quantizes each kept frame to numColors.
+func reencodeGIFFrames(g *gif.GIF, stride int, numColors int) *gif.GIF {
+	out := &gif.GIF{
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+		Config:          g.Config,
+	}
+
+	for i := 0; i < len(g.Image); i += stride {
+		end := i + stride
+		if end > len(g.Image) {
+			end = len(g.Image)
+		}
+
+		delay := 0
+		for _, d := range g.Delay[i:end] {
+			delay += d
+		}
+
+		frame := g.Image[i]
+		pal := medianCutPalette(frame, numColors)
+		paletted := image.NewPaletted(frame.Bounds(), pal)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, frame.Bounds().Min)
+
+		out.Image = append(out.Image, paletted)
+		out.Delay = append(out.Delay, delay)
+		if i < len(g.Disposal) {
+			out.Disposal = append(out.Disposal, g.Disposal[i])
+		}
+	}
+
+	return out
+}
+
+// encodeGIFGlobalPalette re-quantizes every frame of g against one shared
+// palette derived from all of them, then encodes the result.
+func encodeGIFGlobalPalette(g *gif.GIF) ([]byte, error) {
+	frames := make([]image.Image, len(g.Image))
+	for i, frame := range g.Image {
+		frames[i] = frame
+	}
+	globalPalette := medianCutPaletteMulti(frames, 256)
+
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           g.Delay,
+		Disposal:        g.Disposal,
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+		Config:          g.Config,
+	}
+	for i, frame := range g.Image {
+		paletted := image.NewPaletted(frame.Bounds(), globalPalette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, frame.Bounds().Min)
+		out.Image[i] = paletted
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGIF(&buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// recordSizeBudget records how imgBytes fared against the configured budget
+// for size onto result, keyed by "{size}x{size}". Sizes without a configured
+// budget are left unrecorded.
+func recordSizeBudget(result *Result, size int, imgBytes []byte, strategy string) {
+	budget, ok := sizeBudgets[size]
+	if !ok {
+		return
+	}
+	if result.SizeBudgets == nil {
+		result.SizeBudgets = make(map[string]FitResult)
+	}
+	result.SizeBudgets[fmt.Sprintf("%dx%d", size, size)] = FitResult{
+		Bytes:      len(imgBytes),
+		Budget:     budget,
+		Strategy:   strategy,
+		FitsBudget: len(imgBytes) <= budget,
+	}
+}
+
+// sizeBudgetSummary renders a short line for the LLM prompt describing which
+// sizes fit their byte budget, so it can factor that into emoteSuitability28px.
+func sizeBudgetSummary(budgets map[string]FitResult) string {
+	if len(budgets) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(budgets))
+	for k := range budgets {
+		keys = append(keys, k)
+	}
+	sortPkg.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fit := budgets[k]
+		parts = append(parts, fmt.Sprintf("%s=%s", k, map[bool]string{true: "fits", false: "exceeds"}[fit.FitsBudget]))
+	}
+
+	return fmt.Sprintf("Size budget status (whether the encoded file fits the platform's byte limit at that size): %s", strings.Join(parts, ", "))
+}
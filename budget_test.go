@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"25KB", 25 * 1024, false},
+		{"1MB", 1024 * 1024, false},
+		{"512", 512, false},
+		{"512b", 512, false},
+		{" 10 KB ", 10 * 1024, false},
+		{"", 0, true},
+		{"KB", 0, true},
+		{"10gb", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseByteSize(%q): expected error, got %d", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteSize(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSizeBudgets(t *testing.T) {
+	got, err := parseSizeBudgets("28=25KB,56=50KB")
+	if err != nil {
+		t.Fatalf("parseSizeBudgets: unexpected error: %v", err)
+	}
+	want := map[int]int{28: 25 * 1024, 56: 50 * 1024}
+	if len(got) != len(want) {
+		t.Fatalf("parseSizeBudgets = %v, want %v", got, want)
+	}
+	for size, budget := range want {
+		if got[size] != budget {
+			t.Errorf("parseSizeBudgets[%d] = %d, want %d", size, got[size], budget)
+		}
+	}
+
+	if _, err := parseSizeBudgets("28:25KB"); err == nil {
+		t.Error("parseSizeBudgets: expected error for malformed entry, got nil")
+	}
+}
+
+func TestFitBudgetUnconfiguredSizeReturnsUnchanged(t *testing.T) {
+	imgBytes := []byte{1, 2, 3}
+	got, strategy, err := fitBudget(imgBytes, "png", -1)
+	if err != nil {
+		t.Fatalf("fitBudget: unexpected error: %v", err)
+	}
+	if strategy != "none" {
+		t.Errorf("fitBudget strategy = %q, want \"none\"", strategy)
+	}
+	if !bytes.Equal(got, imgBytes) {
+		t.Error("fitBudget: expected bytes to be returned unchanged")
+	}
+}
+
+func TestFitBudgetAlreadyFitsReturnsUnchanged(t *testing.T) {
+	for size, budget := range sizeBudgets {
+		imgBytes := make([]byte, budget)
+		got, strategy, err := fitBudget(imgBytes, "png", size)
+		if err != nil {
+			t.Fatalf("fitBudget: unexpected error: %v", err)
+		}
+		if strategy != "none" {
+			t.Errorf("fitBudget strategy = %q, want \"none\"", strategy)
+		}
+		if len(got) != len(imgBytes) {
+			t.Errorf("fitBudget: got %d bytes, want %d", len(got), len(imgBytes))
+		}
+		break
+	}
+}
+
+func TestFitPNGBudgetShrinksUnderBudget(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x + y), A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+
+	budget := len(buf.Bytes()) / 2
+	fitted, strategy, err := fitPNGBudget(buf.Bytes(), budget)
+	if err != nil {
+		t.Fatalf("fitPNGBudget: unexpected error: %v", err)
+	}
+	if strategy == "" {
+		t.Error("fitPNGBudget: expected a non-empty strategy")
+	}
+	if len(fitted) == 0 {
+		t.Error("fitPNGBudget: expected non-empty output")
+	}
+}
+
+func TestFitGIFBudgetShrinksUnderBudget(t *testing.T) {
+	g := &gif.GIF{Config: image.Config{Width: 32, Height: 32}}
+	for f := 0; f < 4; f++ {
+		paletted := image.NewPaletted(image.Rect(0, 0, 32, 32), palette256())
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				paletted.Set(x, y, color.RGBA{R: uint8((x + f) * 7), G: uint8((y + f) * 5), B: uint8(x ^ y), A: 0xff})
+			}
+		}
+		g.Image = append(g.Image, paletted)
+		g.Delay = append(g.Delay, 10)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGIF(&buf, g); err != nil {
+		t.Fatalf("encodeGIF: %v", err)
+	}
+
+	budget := len(buf.Bytes()) / 2
+	fitted, strategy, err := fitGIFBudget(buf.Bytes(), budget)
+	if err != nil {
+		t.Fatalf("fitGIFBudget: unexpected error: %v", err)
+	}
+	if strategy == "none" {
+		t.Error("fitGIFBudget: expected a reduction strategy, got \"none\"")
+	}
+	if len(fitted) == 0 {
+		t.Error("fitGIFBudget: expected non-empty output")
+	}
+}
+
+func TestRecordSizeBudget(t *testing.T) {
+	result := &Result{}
+	for size, budget := range sizeBudgets {
+		imgBytes := make([]byte, budget+1)
+		recordSizeBudget(result, size, imgBytes, "none")
+
+		key := fmt.Sprintf("%dx%d", size, size)
+		fit, ok := result.SizeBudgets[key]
+		if !ok {
+			t.Fatalf("recordSizeBudget: missing entry for %q", key)
+		}
+		if fit.FitsBudget {
+			t.Errorf("recordSizeBudget: FitsBudget = true, want false for %d bytes over a %d budget", len(imgBytes), budget)
+		}
+		break
+	}
+
+	recordSizeBudget(result, -1, []byte{1}, "none")
+	if _, ok := result.SizeBudgets[fmt.Sprintf("%dx%d", -1, -1)]; ok {
+		t.Error("recordSizeBudget: unconfigured size should not be recorded")
+	}
+}
+
+func palette256() color.Palette {
+	pal := make(color.Palette, 0, 256)
+	for i := 0; i < 256; i++ {
+		pal = append(pal, color.RGBA{R: uint8(i), G: uint8(255 - i), B: uint8(i * 2), A: 0xff})
+	}
+	return pal
+}
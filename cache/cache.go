@@ -0,0 +1,89 @@
+// Package cache is a small on-disk perceptual-hash dedup cache. Callers hash
+// their own images (with github.com/corona10/goimagehash or similar) and use
+// this package purely to store and look up the resulting hashes against
+// opaque JSON results, so it has no dependency on any particular result
+// shape.
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Entry is one cached result, keyed by perceptual hash.
+type Entry struct {
+	Hash   uint64          `json:"hash"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Cache is a JSON-file-backed store of Entry, safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	entries []Entry
+}
+
+// Open loads path if it exists, or returns an empty Cache that will create
+// path on the first Put.
+func Open(path string) (*Cache, error) {
+	c := &Cache{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return c, nil
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("cache: parsing %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Lookup returns the result of the closest stored entry within maxDistance
+// Hamming distance of hash, if any.
+func (c *Cache) Lookup(hash uint64, maxDistance int) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bestDistance := -1
+	var bestResult json.RawMessage
+	for _, entry := range c.entries {
+		distance := bits.OnesCount64(hash ^ entry.Hash)
+		if distance <= maxDistance && (bestDistance == -1 || distance < bestDistance) {
+			bestDistance = distance
+			bestResult = entry.Result
+		}
+	}
+	return bestResult, bestDistance != -1
+}
+
+// Put appends a new entry and persists the cache to disk.
+func (c *Cache) Put(hash uint64, result json.RawMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(c.entries, Entry{Hash: hash, Result: result})
+	return c.save()
+}
+
+func (c *Cache) save() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
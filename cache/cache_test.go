@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenMissingFileReturnsEmptyCache(t *testing.T) {
+	c, err := Open(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	if _, ok := c.Lookup(0, 10); ok {
+		t.Error("Lookup on empty cache: expected no match")
+	}
+}
+
+func TestLookupReturnsClosestWithinDistance(t *testing.T) {
+	c := &Cache{entries: []Entry{
+		{Hash: 0b0000, Result: json.RawMessage(`"far"`)},
+		{Hash: 0b0001, Result: json.RawMessage(`"near"`)},
+	}}
+
+	result, ok := c.Lookup(0b0011, 2)
+	if !ok {
+		t.Fatal("Lookup: expected a match")
+	}
+	if string(result) != `"near"` {
+		t.Errorf("Lookup result = %s, want %q", result, `"near"`)
+	}
+}
+
+func TestLookupRespectsMaxDistance(t *testing.T) {
+	c := &Cache{entries: []Entry{
+		{Hash: 0b0000, Result: json.RawMessage(`"entry"`)},
+	}}
+
+	if _, ok := c.Lookup(0b1111, 2); ok {
+		t.Error("Lookup: expected no match beyond maxDistance")
+	}
+}
+
+func TestPutPersistsAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "cache.json")
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	if err := c.Put(42, json.RawMessage(`{"ok":true}`)); err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+
+	reloaded, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open (reload): unexpected error: %v", err)
+	}
+	result, ok := reloaded.Lookup(42, 0)
+	if !ok {
+		t.Fatal("Lookup after reload: expected a match")
+	}
+	var got struct{ Ok bool }
+	if err := json.Unmarshal(result, &got); err != nil {
+		t.Fatalf("Unmarshal result: %v", err)
+	}
+	if !got.Ok {
+		t.Errorf("Lookup after reload = %s, want ok=true", result)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+
+	"github.com/corona10/goimagehash"
+
+	"github.com/emmaly/image-categorizer/cache"
+)
+
+var (
+	cacheMaxDistance = mustGetEnvInt("CACHE_MAX_DISTANCE", 5)
+	dedupCache       = mustOpenCache(mustGetEnvString("CACHE_PATH", "cache.json"))
+)
+
+func mustOpenCache(path string) *cache.Cache {
+	c, err := cache.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// phash28 computes a perceptual hash of the 28x28 render image-categorizer
+// already produces for every input. Animated images are hashed on their
+// middle frame, which is stable enough to catch re-submitted near-duplicates
+// without the cost of hashing every frame.
+func phash28(imgBytes []byte) (uint64, error) {
+	img, err := decode28(imgBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	hash, err := goimagehash.DifferenceHash(img)
+	if err != nil {
+		return 0, err
+	}
+	return hash.GetHash(), nil
+}
+
+func decode28(imgBytes []byte) (image.Image, error) {
+	if len(imgBytes) > 3 && imgBytes[0] == 0x47 && imgBytes[1] == 0x49 && imgBytes[2] == 0x46 { // GIF magic number
+		g, err := gif.DecodeAll(bytes.NewReader(imgBytes))
+		if err != nil {
+			return nil, err
+		}
+		if len(g.Image) == 0 {
+			return nil, fmt.Errorf("decode28: GIF has no frames")
+		}
+		return g.Image[len(g.Image)/2], nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+	return img, err
+}
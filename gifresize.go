@@ -0,0 +1,272 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	sortPkg "sort"
+
+	"github.com/nfnt/resize"
+	"golang.org/x/image/draw"
+)
+
+// GIFQuantizer selects how resizeGIFToSquare derives each frame's palette.
+type GIFQuantizer int
+
+const (
+	// QuantizerMedianCut derives a fresh palette per frame via median-cut.
+	QuantizerMedianCut GIFQuantizer = iota
+	// QuantizerPlan9 quantizes against the fixed image/color/palette.Plan9 palette.
+	QuantizerPlan9
+	// QuantizerWebSafe quantizes against the fixed image/color/palette.WebSafe palette.
+	QuantizerWebSafe
+)
+
+// GIFResizeOptions controls how resizeGIFToSquare quantizes resized frames.
+type GIFResizeOptions struct {
+	Quantizer GIFQuantizer
+	Dither    bool
+	// PaletteLen is the target palette size for QuantizerMedianCut. Ignored
+	// by the fixed palettes. Defaults to 256 when <= 0.
+	PaletteLen int
+}
+
+// DefaultGIFResizeOptions matches the quality processImage has always aimed for.
+var DefaultGIFResizeOptions = GIFResizeOptions{
+	Quantizer:  QuantizerMedianCut,
+	Dither:     true,
+	PaletteLen: 256,
+}
+
+// resizeGIFToSquare resizes every frame of g to a size x size square.
+//
+// Each frame is first composited onto an RGBA canvas at the GIF's logical
+// bounds, honoring disposal methods, then resized with Lanczos3, then
+// quantized back down to a paletted image per opts. LoopCount,
+// BackgroundIndex, and Disposal are propagated onto the result.
+func resizeGIFToSquare(g *gif.GIF, size uint, opts GIFResizeOptions) *gif.GIF {
+	if opts.PaletteLen <= 0 {
+		opts.PaletteLen = 256
+	}
+
+	canvas := image.NewRGBA(gifCanvasBounds(g))
+
+	resized := &gif.GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           make([]int, len(g.Delay)),
+		Disposal:        append([]byte(nil), g.Disposal...),
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+		Config: image.Config{
+			Width:  int(size),
+			Height: int(size),
+		},
+	}
+
+	for i, frame := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frameRGBA := cloneRGBA(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+
+		resized.Image[i] = quantizeFrame(resizeRGBAToSquare(frameRGBA, size), opts)
+		resized.Delay[i] = g.Delay[i]
+	}
+
+	return resized
+}
+
+// gifCanvasBounds returns the logical canvas a GIF's frames are composited onto.
+func gifCanvasBounds(g *gif.GIF) image.Rectangle {
+	if g.Config.Width > 0 && g.Config.Height > 0 {
+		return image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	}
+	return g.Image[0].Bounds()
+}
+
+func cloneRGBA(src *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	return dst
+}
+
+// resizeRGBAToSquare scales img to fit within a size x size square, centered,
+// matching the aspect-preserving letterboxing resizeToSquare uses for still images.
+func resizeRGBAToSquare(img *image.RGBA, size uint) *image.RGBA {
+	sizeInt := int(size)
+	bounds := img.Bounds()
+
+	scaleX := float64(size) / float64(bounds.Dx())
+	scaleY := float64(size) / float64(bounds.Dy())
+	scale := scaleX
+	if scaleY < scaleX {
+		scale = scaleY
+	}
+
+	newWidth := uint(float64(bounds.Dx()) * scale)
+	newHeight := uint(float64(bounds.Dy()) * scale)
+
+	scaled := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+
+	square := image.NewRGBA(image.Rect(0, 0, sizeInt, sizeInt))
+	x := (sizeInt - int(newWidth)) / 2
+	y := (sizeInt - int(newHeight)) / 2
+	draw.Draw(square, image.Rect(x, y, x+int(newWidth), y+int(newHeight)), scaled, image.Point{}, draw.Over)
+
+	return square
+}
+
+func quantizeFrame(img *image.RGBA, opts GIFResizeOptions) *image.Paletted {
+	pal := quantizePalette(img, opts)
+	paletted := image.NewPaletted(img.Bounds(), pal)
+	if opts.Dither {
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, image.Point{})
+	} else {
+		draw.Draw(paletted, paletted.Bounds(), img, image.Point{}, draw.Src)
+	}
+	return paletted
+}
+
+func quantizePalette(img image.Image, opts GIFResizeOptions) color.Palette {
+	switch opts.Quantizer {
+	case QuantizerPlan9:
+		return palette.Plan9
+	case QuantizerWebSafe:
+		return palette.WebSafe
+	default:
+		return medianCutPalette(img, opts.PaletteLen)
+	}
+}
+
+// medianCutPalette derives a palette of at most numColors entries from img's
+// opaque pixels via median-cut, reserving one entry for transparency if img
+// has any transparent pixels.
+func medianCutPalette(img image.Image, numColors int) color.Palette {
+	pixels, hasTransparent := collectOpaquePixels(img)
+	return medianCutFromPixels(pixels, hasTransparent, numColors)
+}
+
+// medianCutPaletteMulti derives a single shared palette across several
+// frames, for callers (like fitGIFBudget's global-palette fallback) that
+// need one color table for every frame rather than one per frame.
+func medianCutPaletteMulti(imgs []image.Image, numColors int) color.Palette {
+	var pixels [][3]int32
+	hasTransparent := false
+	for _, img := range imgs {
+		p, t := collectOpaquePixels(img)
+		pixels = append(pixels, p...)
+		hasTransparent = hasTransparent || t
+	}
+	return medianCutFromPixels(pixels, hasTransparent, numColors)
+}
+
+func collectOpaquePixels(img image.Image) ([][3]int32, bool) {
+	bounds := img.Bounds()
+	pixels := make([][3]int32, 0, bounds.Dx()*bounds.Dy())
+	hasTransparent := false
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				hasTransparent = true
+				continue
+			}
+			pixels = append(pixels, [3]int32{int32(r >> 8), int32(g >> 8), int32(b >> 8)})
+		}
+	}
+	return pixels, hasTransparent
+}
+
+func medianCutFromPixels(pixels [][3]int32, hasTransparent bool, numColors int) color.Palette {
+	if len(pixels) == 0 {
+		return color.Palette{color.Transparent}
+	}
+
+	maxColors := numColors
+	if hasTransparent {
+		maxColors--
+	}
+	if maxColors < 1 {
+		maxColors = 1
+	}
+
+	buckets := [][][3]int32{pixels}
+	for len(buckets) < maxColors {
+		splitIdx, splitChannel, maxRange := -1, 0, int32(-1)
+		for i, bucket := range buckets {
+			if len(bucket) < 2 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := channelRange(bucket, ch)
+				if hi-lo > maxRange {
+					maxRange, splitIdx, splitChannel = hi-lo, i, ch
+				}
+			}
+		}
+		if splitIdx == -1 {
+			break
+		}
+
+		bucket := buckets[splitIdx]
+		sortPkg.Slice(bucket, func(i, j int) bool { return bucket[i][splitChannel] < bucket[j][splitChannel] })
+		mid := len(bucket) / 2
+
+		buckets[splitIdx] = bucket[:mid]
+		buckets = append(buckets, bucket[mid:])
+	}
+
+	pal := make(color.Palette, 0, numColors)
+	if hasTransparent {
+		pal = append(pal, color.NRGBA{})
+	}
+	for _, bucket := range buckets {
+		pal = append(pal, averageColor(bucket))
+	}
+	return pal
+}
+
+func channelRange(bucket [][3]int32, ch int) (int32, int32) {
+	lo, hi := bucket[0][ch], bucket[0][ch]
+	for _, c := range bucket[1:] {
+		if c[ch] < lo {
+			lo = c[ch]
+		}
+		if c[ch] > hi {
+			hi = c[ch]
+		}
+	}
+	return lo, hi
+}
+
+func averageColor(bucket [][3]int32) color.Color {
+	var r, g, b int64
+	for _, c := range bucket {
+		r += int64(c[0])
+		g += int64(c[1])
+		b += int64(c[2])
+	}
+	n := int64(len(bucket))
+	return color.NRGBA{
+		R: uint8(r / n),
+		G: uint8(g / n),
+		B: uint8(b / n),
+		A: 0xff,
+	}
+}
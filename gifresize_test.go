@@ -0,0 +1,113 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestMedianCutPaletteRespectsMaxColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: uint8(x ^ y), A: 0xff})
+		}
+	}
+
+	pal := medianCutPalette(img, 8)
+	if len(pal) > 8 {
+		t.Errorf("medianCutPalette: got %d colors, want at most 8", len(pal))
+	}
+	if len(pal) == 0 {
+		t.Error("medianCutPalette: expected a non-empty palette")
+	}
+}
+
+func TestMedianCutPaletteReservesTransparentEntry(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.RGBA{}) // fully transparent
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if x == 0 && y == 0 {
+				continue
+			}
+			img.Set(x, y, color.RGBA{R: uint8(x * 60), G: uint8(y * 60), B: 100, A: 0xff})
+		}
+	}
+
+	pal := medianCutPalette(img, 4)
+	if len(pal) == 0 {
+		t.Fatal("medianCutPalette: expected a non-empty palette")
+	}
+	if pal[0] != (color.NRGBA{}) {
+		t.Errorf("medianCutPalette: expected the first entry to be the reserved transparent color, got %v", pal[0])
+	}
+}
+
+func TestMedianCutFromPixelsEmptyReturnsTransparent(t *testing.T) {
+	pal := medianCutFromPixels(nil, false, 8)
+	if len(pal) != 1 || pal[0] != color.Transparent {
+		t.Errorf("medianCutFromPixels(nil): got %v, want [color.Transparent]", pal)
+	}
+}
+
+func TestGifCanvasBoundsUsesConfigWhenPresent(t *testing.T) {
+	g := &gif.GIF{
+		Config: image.Config{Width: 100, Height: 50},
+		Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 10, 10), color.Palette{color.Black})},
+	}
+	bounds := gifCanvasBounds(g)
+	if bounds.Dx() != 100 || bounds.Dy() != 50 {
+		t.Errorf("gifCanvasBounds = %v, want 100x50", bounds)
+	}
+}
+
+func TestGifCanvasBoundsFallsBackToFirstFrame(t *testing.T) {
+	g := &gif.GIF{
+		Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 30, 20), color.Palette{color.Black})},
+	}
+	bounds := gifCanvasBounds(g)
+	if bounds.Dx() != 30 || bounds.Dy() != 20 {
+		t.Errorf("gifCanvasBounds = %v, want 30x20", bounds)
+	}
+}
+
+// TestResizeGIFToSquareDisposalBackground checks that a DisposalBackground
+// frame is cleared to transparent on canvas before the next frame is drawn,
+// rather than leaving the previous frame's pixels showing through.
+func TestResizeGIFToSquareDisposalBackground(t *testing.T) {
+	bounds := image.Rect(0, 0, 4, 4)
+	opaque := image.NewPaletted(bounds, color.Palette{color.RGBA{R: 0xff, A: 0xff}, color.Transparent})
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0
+	}
+
+	transparentFrame := image.NewPaletted(bounds, color.Palette{color.RGBA{R: 0xff, A: 0xff}, color.Transparent})
+	for i := range transparentFrame.Pix {
+		transparentFrame.Pix[i] = 1
+	}
+
+	g := &gif.GIF{
+		Image:    []*image.Paletted{opaque, transparentFrame},
+		Delay:    []int{10, 10},
+		Disposal: []byte{gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	resized := resizeGIFToSquare(g, 4, DefaultGIFResizeOptions)
+	if len(resized.Image) != 2 {
+		t.Fatalf("resizeGIFToSquare: got %d frames, want 2", len(resized.Image))
+	}
+
+	second := resized.Image[1]
+	for _, px := range second.Pix {
+		if px >= uint8(len(second.Palette)) {
+			t.Fatalf("resizeGIFToSquare: pixel index %d out of range for palette of %d", px, len(second.Palette))
+		}
+		_, _, _, a := second.Palette[px].RGBA()
+		if a != 0 {
+			t.Errorf("resizeGIFToSquare: expected second frame to be fully transparent after DisposalBackground, got alpha %d", a)
+		}
+	}
+}
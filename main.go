@@ -3,14 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"io"
 	"os"
+	"path/filepath"
 	sortPkg "sort"
 	"strings"
 	"sync"
@@ -20,20 +21,65 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"github.com/sashabaranov/go-openai/jsonschema"
 	"golang.org/x/image/draw"
+
+	"github.com/emmaly/image-categorizer/mediapipe"
+	"github.com/emmaly/image-categorizer/ratelimit"
+	"github.com/emmaly/image-categorizer/vision"
 )
 
 var (
-	maxConcurrent   = mustGetEnvInt("OPENAI_API_MAX_CONCURRENT", 1)
-	client          = openai.NewClient(os.Getenv("OPENAI_API_KEY"))
-	promptText      = os.Getenv("PROMPT_TEXT")
-	emoteNamePrefix = os.Getenv("EMOTENAME_PREFIX")
-	workingDir      = os.Getenv("WORKING_DIR")
-	responseSchema  = &jsonschema.Definition{}
-	limiter         = NewLimiter(mustGetEnvInt("OPENAI_API_MAX_RPM", 10))
-	imageCategories = sort(unique(mustGetEnvStringSlice("IMAGE_CATEGORIES", "celebration,sad,happy,angry,love,surprise,disgust,fear,neutral")))
-	resizeTargets   = sortDesc(unique(mustGetEnvIntSlice("IMAGE_SIZES", "320,256,112,56,28")))
+	maxConcurrent          = mustGetEnvInt("OPENAI_API_MAX_CONCURRENT", 1)
+	mediapipeMaxConcurrent = mustGetEnvInt("MEDIAPIPE_MAX_CONCURRENT", 2)
+	client                 = openai.NewClient(os.Getenv("OPENAI_API_KEY"))
+	promptText             = os.Getenv("PROMPT_TEXT")
+	emoteNamePrefix        = os.Getenv("EMOTENAME_PREFIX")
+	workingDir             = os.Getenv("WORKING_DIR")
+	responseSchema         = &jsonschema.Definition{}
+	visionBackend          = mustGetEnvString("VISION_BACKEND", "openai")
+	categorizer            = newCategorizer(visionBackend)
+	imageCategories        = sort(unique(mustGetEnvStringSlice("IMAGE_CATEGORIES", "celebration,sad,happy,angry,love,surprise,disgust,fear,neutral")))
+	resizeTargets          = sortDesc(unique(mustGetEnvIntSlice("IMAGE_SIZES", "320,256,112,56,28")))
+	mediaPipeline          = mediapipe.New(mediapipeMaxConcurrent)
+
+	// processingSem bounds how many images (CLI args or HTTP jobs) are
+	// decoded/resized/categorized at once; it's the job queue both `main`
+	// and `serve` dispatch through.
+	processingSem = make(chan struct{}, maxConcurrent)
 )
 
+// newCategorizer picks the vision backend named by VISION_BACKEND. Each
+// backend carries its own rate limiter, configured from its own *_API_MAX_RPM
+// env var, so switching backends doesn't inherit another backend's limits.
+func newCategorizer(backend string) vision.Categorizer {
+	switch backend {
+	case "anthropic":
+		return vision.NewAnthropic(
+			os.Getenv("ANTHROPIC_API_KEY"),
+			mustGetEnvString("ANTHROPIC_MODEL", "claude-3-5-sonnet-latest"),
+			mustGetEnvInt("ANTHROPIC_MAX_TOKENS", 1024),
+			ratelimit.NewLimiter(mustGetEnvInt("ANTHROPIC_API_MAX_RPM", 10)),
+		)
+	case "gemini":
+		return vision.NewGemini(
+			os.Getenv("GEMINI_API_KEY"),
+			mustGetEnvString("GEMINI_MODEL", "gemini-1.5-flash"),
+			ratelimit.NewLimiter(mustGetEnvInt("GEMINI_API_MAX_RPM", 10)),
+		)
+	case "ollama":
+		return vision.NewOllama(
+			mustGetEnvString("OLLAMA_HOST", "http://localhost:11434"),
+			mustGetEnvString("OLLAMA_MODEL", "llava"),
+			ratelimit.NewLimiter(mustGetEnvInt("OLLAMA_API_MAX_RPM", 60)),
+		)
+	default:
+		return vision.NewOpenAI(
+			client,
+			mustGetEnvString("OPENAI_MODEL", openai.GPT4o),
+			ratelimit.NewLimiter(mustGetEnvInt("OPENAI_API_MAX_RPM", 10)),
+		)
+	}
+}
+
 func init() {
 	if workingDir != "" {
 		if err := os.Chdir(workingDir); err != nil {
@@ -59,12 +105,16 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve()
+		return
+	}
+
 	if len(os.Args) == 1 {
 		fmt.Println("Please provide a path to one or more valid image files as an argument.")
 		return
 	}
 
-	var sem = make(chan struct{}, maxConcurrent)
 	var wg sync.WaitGroup
 	results := make(chan Result, len(os.Args)-1)
 
@@ -73,13 +123,12 @@ func main() {
 		defer wg.Done() // Remove this loop from the WaitGroup when the goroutine completes
 
 		for _, path := range os.Args[1:] {
-			limiter.Wait()    // Wait until the limiter allows the next request
-			sem <- struct{}{} // Wait until there is room in the semaphore
-			wg.Add(1)         // Increment the WaitGroup counter
+			processingSem <- struct{}{} // Wait until there is room in the semaphore
+			wg.Add(1)                   // Increment the WaitGroup counter
 			go func() {
 				defer wg.Done() // Decrement the WaitGroup counter
 				processImage(path, results)
-				<-sem // Release a spot in the semaphore
+				<-processingSem // Release a spot in the semaphore
 			}()
 		}
 	}()
@@ -102,36 +151,126 @@ func main() {
 	}
 }
 
+// pathResults memoizes processImage by source path: if the same path is
+// passed more than once (e.g. twice on the CLI), the second caller gets the
+// first caller's Result instead of decoding/resizing/categorizing again.
+var pathResults sync.Map // map[string]*pathResult
+
+type pathResult struct {
+	once   sync.Once
+	result Result
+}
+
 func processImage(path string, results chan<- Result) {
-	dataURIs := []string{}
-	imagesBytes := make(map[string][]byte)
+	v, _ := pathResults.LoadOrStore(path, &pathResult{})
+	pr := v.(*pathResult)
+	pr.once.Do(func() {
+		f, err := os.Open(path)
+		if err != nil {
+			pr.result = Result{SourceFilepath: path, Error: err}
+			return
+		}
+		defer f.Close()
+		pr.result = doProcessImage(context.Background(), path, f, noProgress)
+	})
+	results <- pr.result
+}
+
+// noProgress is the progress callback for callers (the CLI) that don't
+// report per-stage progress anywhere.
+func noProgress(stage string) {}
+
+// doProcessImage decodes, resizes, categorizes, and saves the image read
+// from r. sourceName is used only for the result's SourceFilepath and to
+// guess a file extension when r isn't already a file on disk; progress is
+// called as each stage completes ("decoded", "resized 320", "llm
+// complete", "saved"), which `serve` uses to drive its SSE job streams. ctx
+// bounds the mediapipe decode and vision-backend calls, so a caller that
+// accepts uploads from arbitrary network callers (`serve`) can cap how long
+// a single job may wedge a processingSem slot.
+func doProcessImage(ctx context.Context, sourceName string, r io.Reader, progress func(stage string)) Result {
+	visionImages := []vision.Image{}
+	imagesBytes := make(map[string][]byte)  // only the sizes the vision backend and dedup cache need stay resident
+	pendingFiles := make(map[string]string) // size key -> temp file path, renamed once the emote name is known
 
 	result := &Result{
-		SourceFilepath: path,
+		SourceFilepath: sourceName,
 	}
 	defer func() {
-		results <- *result
+		if result.Error != nil {
+			for _, tmp := range pendingFiles {
+				os.Remove(tmp)
+			}
+		}
 	}()
 
+	// mediapipe shells out to ffprobe/ffmpeg, which need a real path on
+	// disk; spool r there unless it's already a file (the common CLI
+	// case), so uploads only pay for one extra copy, not two.
+	path, cleanupSpool, err := spoolToTemp(sourceName, r)
+	if err != nil {
+		result.Error = err
+		return *result
+	}
+	defer cleanupSpool()
+
 	// Check if the file exists and is a valid image file
-	img, gifImg, err := getImage(path)
+	img, gifImg, err := getImage(ctx, path)
 	if err != nil {
 		result.Error = err
-		return
+		return *result
 	}
+	progress("decoded")
 
 	// Original image size as string
 	originalSize := fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy())
 
+	// writeSize streams imgBytes straight to a temp file in the same pass
+	// that resized and encoded it, rather than holding every size's bytes
+	// in a map for the lifetime of the whole request. The temp file is
+	// renamed to its real name once the emote name is known, below.
+	writeSize := func(newSize string, imgBytes []byte) error {
+		tmp, err := os.CreateTemp(".", "image-categorizer-*.tmp")
+		if err != nil {
+			return err
+		}
+		defer tmp.Close()
+		if _, err := tmp.Write(imgBytes); err != nil {
+			return err
+		}
+		pendingFiles[newSize] = tmp.Name()
+		return nil
+	}
+
+	var buf bytes.Buffer
+
 	// Convert original size to PNG or GIF
 	if gifImg != nil {
-		gifBytes, err := encodeGIF(gifImg)
-		if err != nil {
+		if err := encodeGIF(&buf, gifImg); err != nil {
 			result.Error = err
-			return
+			return *result
+		}
+
+		origBytes := buf.Bytes()
+		// A square original that happens to land exactly on a configured
+		// size (e.g. a 320x320 source) skips the resize loop below, so its
+		// budget has to be enforced here instead or it ships unchecked.
+		if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w == h {
+			fitted, strategy, err := fitBudget(origBytes, "gif", w)
+			if err != nil {
+				result.Error = err
+				return *result
+			}
+			recordSizeBudget(result, w, fitted, strategy)
+			origBytes = fitted
+		}
+
+		imagesBytes[originalSize] = append([]byte(nil), origBytes...)
+		visionImages = append(visionImages, imageToVisionImage(imagesBytes[originalSize]))
+		if err := writeSize(originalSize, imagesBytes[originalSize]); err != nil {
+			result.Error = err
+			return *result
 		}
-		imagesBytes[originalSize] = gifBytes
-		dataURIs = append(dataURIs, imgBytesToDataURI(imagesBytes[originalSize]))
 
 		// Convert to each size (GIF)
 		for _, size := range resizeTargets {
@@ -141,23 +280,57 @@ func processImage(path string, results chan<- Result) {
 				continue // Skip resizing if the size is the same as the original
 			}
 
-			imgResized := resizeGIFToSquare(gifImg, uint(size))
-			gifBytes, err = encodeGIF(imgResized)
+			imgResized := resizeGIFToSquare(gifImg, uint(size), DefaultGIFResizeOptions)
+
+			buf.Reset()
+			if err := encodeGIF(&buf, imgResized); err != nil {
+				result.Error = err
+				return *result
+			}
+
+			fitted, strategy, err := fitBudget(buf.Bytes(), "gif", size)
 			if err != nil {
 				result.Error = err
-				return
+				return *result
 			}
-			imagesBytes[newSize] = gifBytes
+			recordSizeBudget(result, size, fitted, strategy)
+
+			if newSize == "28x28" {
+				imagesBytes[newSize] = append([]byte(nil), fitted...)
+			}
+			if err := writeSize(newSize, fitted); err != nil {
+				result.Error = err
+				return *result
+			}
+			progress(fmt.Sprintf("resized %d", size))
 		}
-		dataURIs = append(dataURIs, imgBytesToDataURI(imagesBytes["28x28"]))
+		visionImages = append(visionImages, imageToVisionImage(imagesBytes["28x28"]))
 	} else {
-		pngBytes, err := imageToPNG(img)
-		if err != nil {
+		if err := imageToPNG(&buf, img); err != nil {
 			result.Error = err
-			return
+			return *result
+		}
+
+		origBytes := buf.Bytes()
+		// A square original that happens to land exactly on a configured
+		// size (e.g. a 320x320 source) skips the resize loop below, so its
+		// budget has to be enforced here instead or it ships unchecked.
+		if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w == h {
+			fitted, strategy, err := fitBudget(origBytes, "png", w)
+			if err != nil {
+				result.Error = err
+				return *result
+			}
+			recordSizeBudget(result, w, fitted, strategy)
+			origBytes = fitted
+		}
+
+		imagesBytes[originalSize] = append([]byte(nil), origBytes...)
+		visionImages = append(visionImages, imageToVisionImage(imagesBytes[originalSize]))
+		if err := writeSize(originalSize, imagesBytes[originalSize]); err != nil {
+			result.Error = err
+			return *result
 		}
-		imagesBytes[originalSize] = pngBytes
-		dataURIs = append(dataURIs, imgBytesToDataURI(imagesBytes[originalSize]))
 
 		// Convert to each size (PNG)
 		for _, size := range resizeTargets {
@@ -168,185 +341,184 @@ func processImage(path string, results chan<- Result) {
 			}
 
 			imgResized := resizeToSquare(img, uint(size))
-			pngBytes, err = imageToPNG(imgResized)
+
+			buf.Reset()
+			if err := imageToPNG(&buf, imgResized); err != nil {
+				result.Error = err
+				return *result
+			}
+
+			fitted, strategy, err := fitBudget(buf.Bytes(), "png", size)
 			if err != nil {
 				result.Error = err
-				return
+				return *result
+			}
+			recordSizeBudget(result, size, fitted, strategy)
+
+			if newSize == "28x28" {
+				imagesBytes[newSize] = append([]byte(nil), fitted...)
+			}
+			if err := writeSize(newSize, fitted); err != nil {
+				result.Error = err
+				return *result
 			}
-			imagesBytes[newSize] = pngBytes
+			progress(fmt.Sprintf("resized %d", size))
 		}
-		dataURIs = append(dataURIs, imgBytesToDataURI(imagesBytes["28x28"]))
+		visionImages = append(visionImages, imageToVisionImage(imagesBytes["28x28"]))
 	}
 
-	// Message Parts
-	messageParts := []openai.ChatMessagePart{
-		{
-			Type: openai.ChatMessagePartTypeText,
-			Text: fmt.Sprintf("Please review and understand the image. Using only the `respond` function call, provide values to all required or applicable fields. For all fields, use the largest provided image. For the field(s) pertaining to specific sizes, use the correct image matching that size. If an image is flagged as NSFW, use an emote name that clearly states NSFW. %s\nImage categories: {%s}", promptText, strings.Join(imageCategories, ",")),
-		},
-	}
-	for _, dataURI := range dataURIs {
-		messageParts = append(messageParts, openai.ChatMessagePart{
-			Type: openai.ChatMessagePartTypeImageURL,
-			ImageURL: &openai.ChatMessageImageURL{
-				URL: dataURI,
-			},
-		})
+	// Perceptual-hash dedup: skip the vision call entirely if a
+	// near-duplicate image has already been categorized.
+	hash, hashErr := phash28(imagesBytes["28x28"])
+	if hashErr == nil {
+		if cached, ok := dedupCache.Lookup(hash, cacheMaxDistance); ok {
+			if err := json.Unmarshal(cached, &result.Response); err != nil {
+				result.Error = err
+				return *result
+			}
+			result.Cached = true
+		}
 	}
 
-	// Create a chat completion request with the image
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: openai.GPT4o,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:         openai.ChatMessageRoleUser,
-					MultiContent: messageParts,
-				},
-			},
-			Tools: []openai.Tool{
-				{
-					Type: openai.ToolTypeFunction,
-					Function: &openai.FunctionDefinition{
-						Name:        "response",
-						Description: "Return the results in a structured format",
-						Parameters:  responseSchema,
-					},
-				},
-			},
-		},
-	)
-	if err != nil {
-		result.Error = err
-		return
-	}
+	if !result.Cached {
+		prompt := fmt.Sprintf("Please review and understand the image. Using only the `respond` function call, provide values to all required or applicable fields. For all fields, use the largest provided image. For the field(s) pertaining to specific sizes, use the correct image matching that size. If an image is flagged as NSFW, use an emote name that clearly states NSFW. %s\nImage categories: {%s}\n%s", promptText, strings.Join(imageCategories, ","), sizeBudgetSummary(result.SizeBudgets))
 
-	if len(resp.Choices) == 0 {
-		result.Error = fmt.Errorf("no response received")
-		return
-	}
-	if len(resp.Choices[0].Message.ToolCalls) == 0 {
-		result.Error = fmt.Errorf("no tool calls found")
-		return
-	}
+		// Ask the configured vision backend to categorize the image
+		respJSON, err := categorizer.Categorize(ctx, visionImages, prompt, responseSchema)
+		if err != nil {
+			result.Error = err
+			return *result
+		}
 
-	// Unmarshal the response
-	if err := jsonschema.VerifySchemaAndUnmarshal(*responseSchema, []byte(resp.Choices[0].Message.ToolCalls[0].Function.Arguments), result); err != nil {
-		result.Error = err
+		// Unmarshal the response
+		if err := jsonschema.VerifySchemaAndUnmarshal(*responseSchema, respJSON, result); err != nil {
+			result.Error = err
+		}
+
+		if result.Error == nil && hashErr == nil {
+			if responseJSON, err := json.Marshal(result.Response); err == nil {
+				dedupCache.Put(hash, responseJSON)
+			}
+		}
 	}
+	progress("llm complete")
 
-	// Place the emote name prefix on the Twitch emote name and filename
-	result.TwitchEmoteName = emoteNamePrefix + result.TwitchEmoteName
+	// Place the emote name prefix on the Twitch emote name and filename.
+	// TwitchEmoteName is vision-model output and, since `serve` accepts
+	// uploads from arbitrary network callers, untrusted; sanitize it
+	// before it's used as a filename component below.
+	result.TwitchEmoteName = sanitizeFilenameComponent(emoteNamePrefix + result.TwitchEmoteName)
 
-	// Sort imagesBytes keys
-	imagesBytesKeys := make([]string, 0, len(imagesBytes))
-	for k := range imagesBytes {
-		imagesBytesKeys = append(imagesBytesKeys, k)
+	// Rename each size's temp file to its real name now that it's known
+	fileExtension := "png"
+	if gifImg != nil {
+		fileExtension = "gif"
 	}
-	sortPkg.Strings(imagesBytesKeys)
 
-	// Save the images to disk
-	for _, key := range imagesBytesKeys {
-		imgBytes := imagesBytes[key]
-
-		// Determine the file extension based on the image format
-		fileExtension := "png"
-		if len(imgBytes) > 3 && imgBytes[0] == 0x47 && imgBytes[1] == 0x49 && imgBytes[2] == 0x46 { // GIF magic number
-			fileExtension = "gif"
-		}
+	pendingKeys := make([]string, 0, len(pendingFiles))
+	for k := range pendingFiles {
+		pendingKeys = append(pendingKeys, k)
+	}
+	sortPkg.Strings(pendingKeys)
 
-		// Set filename
+	for _, key := range pendingKeys {
 		filename := fmt.Sprintf("%s.%s.%s", result.TwitchEmoteName, key, fileExtension)
 
-		// Save the image to disk
-		if err := saveBytesToDisk(imgBytes, filename); err != nil {
+		if err := os.Rename(pendingFiles[key], filename); err != nil {
 			result.Error = err
-			return
+			return *result
 		}
+		delete(pendingFiles, key)
 
-		// Append the filename to the result
 		result.DestinationFiles = append(result.DestinationFiles, filename)
 	}
 
 	// Save the result to disk
 	if err := saveResultToDisk(*result, fmt.Sprintf("%s.json", result.TwitchEmoteName)); err != nil {
 		result.Error = err
-		return
+		return *result
 	}
+	progress("saved")
+
+	return *result
 }
 
-func getImage(filename string) (image.Image, *gif.GIF, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, nil, err
+// spoolToTemp returns a real filesystem path for r's contents: if r is
+// already an *os.File (the CLI's case, opened straight from the path the
+// user gave), its own path is reused unchanged; otherwise (an HTTP upload)
+// r is copied into a temp file, since mediapipe's ffprobe/ffmpeg need a
+// real path rather than a reader. The returned cleanup removes that temp
+// file; it's a no-op when the caller's own file was reused.
+func spoolToTemp(sourceName string, r io.Reader) (path string, cleanup func(), err error) {
+	if f, ok := r.(*os.File); ok {
+		return f.Name(), func() {}, nil
 	}
-	defer file.Close()
 
-	imageConfig, modelConfig, err := func(filename string) (image.Config, string, error) {
-		return image.DecodeConfig(file)
-	}(filename)
+	tmp, err := os.CreateTemp(".", "image-categorizer-upload-*"+filepath.Ext(sourceName))
 	if err != nil {
-		return nil, nil, err
+		return "", nil, err
 	}
+	defer tmp.Close()
 
-	if imageConfig.ColorModel == nil {
-		return nil, nil, fmt.Errorf("image.DecodeConfig returned a nil ColorModel")
+	if _, err := io.Copy(tmp, r); err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
 	}
 
-	if imageConfig.Height == 0 || imageConfig.Width == 0 {
-		return nil, nil, fmt.Errorf("image.DecodeConfig returned a zero Height or Width")
-	}
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
 
-	if imageConfig.Width > 4096 || imageConfig.Height > 4096 {
-		return nil, nil, fmt.Errorf("image.DecodeConfig returned a Width or Height greater than hardcoded maximum size of 4096")
+func getImage(ctx context.Context, filename string) (image.Image, *gif.GIF, error) {
+	decoded, err := mediaPipeline.Decode(ctx, filename)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Try to decode as GIF first
-	file.Seek(0, 0) // rewind the file
-	gifImg, err := gif.DecodeAll(file)
-	if err == nil {
-		// It's an animated GIF
+	reader := bytes.NewReader(decoded.Data)
+
+	if decoded.Format == mediapipe.FormatGIF {
+		gifImg, err := gif.DecodeAll(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if bounds := gifCanvasBounds(gifImg); bounds.Dx() > maxImageDimension || bounds.Dy() > maxImageDimension {
+			return nil, nil, fmt.Errorf("decoded image Width or Height greater than hardcoded maximum size of %d", maxImageDimension)
+		}
+
 		return gifImg.Image[0], gifImg, nil
 	}
 
-	// Try to decode as still image
-	file.Seek(0, 0) // rewind the file
-	img, modelDecode, err := image.Decode(file)
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if modelConfig != modelDecode {
-		return nil, nil, fmt.Errorf("image.DecodeConfig and image.Decode return different models")
+	if bounds := img.Bounds(); bounds.Dx() > maxImageDimension || bounds.Dy() > maxImageDimension {
+		return nil, nil, fmt.Errorf("decoded image Width or Height greater than hardcoded maximum size of %d", maxImageDimension)
 	}
 
-	return img, nil, err
+	return img, nil, nil
 }
 
-func imageToPNG(img image.Image) ([]byte, error) {
-	var buf bytes.Buffer
-	err := png.Encode(&buf, img)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
+// maxImageDimension is the hardcoded ceiling on a decoded image's width or
+// height, applied to both the static and animated (GIF) decode paths.
+const maxImageDimension = 4096
 
-func encodeGIF(g *gif.GIF) ([]byte, error) {
-	var buf bytes.Buffer
-	err := gif.EncodeAll(&buf, g)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+func imageToPNG(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
 }
 
-func imgBytesToDataURI(imgBytes []byte) string {
-	base64Img := base64.StdEncoding.EncodeToString(imgBytes)
+func encodeGIF(w io.Writer, g *gif.GIF) error {
+	return gif.EncodeAll(w, g)
+}
 
+func imageToVisionImage(imgBytes []byte) vision.Image {
+	mimeType := "image/png"
 	if len(imgBytes) > 3 && imgBytes[0] == 0x47 && imgBytes[1] == 0x49 && imgBytes[2] == 0x46 { // GIF magic number
-		return fmt.Sprintf("data:image/gif;base64,%s", base64Img)
+		mimeType = "image/gif"
 	}
-
-	return fmt.Sprintf("data:image/png;base64,%s", base64Img)
+	return vision.Image{MIMEType: mimeType, Data: imgBytes}
 }
 
 func resizeImage(img image.Image, width, height uint) image.Image {
@@ -388,52 +560,6 @@ func resizeToSquare(img image.Image, size uint) image.Image {
 	return squareImg
 }
 
-func resizeGIFToSquare(g *gif.GIF, size uint) *gif.GIF {
-	resized := &gif.GIF{
-		Image:     make([]*image.Paletted, len(g.Image)),
-		Delay:     make([]int, len(g.Delay)),
-		LoopCount: g.LoopCount,
-	}
-	for i, frame := range g.Image {
-		resized.Image[i] = resizeToSquarePaletted(frame, size)
-		resized.Delay[i] = g.Delay[i]
-	}
-	return resized
-}
-
-func resizeToSquarePaletted(img *image.Paletted, size uint) *image.Paletted {
-	sizeInt := int(size)
-	bounds := img.Bounds()
-	newImg := image.NewPaletted(image.Rect(0, 0, sizeInt, sizeInt), img.Palette)
-
-	// Calculate scaling factors
-	scaleX := float64(size) / float64(bounds.Dx())
-	scaleY := float64(size) / float64(bounds.Dy())
-	scale := scaleX
-	if scaleY < scaleX {
-		scale = scaleY
-	}
-
-	// Calculate new dimensions
-	newWidth := int(float64(bounds.Dx()) * scale)
-	newHeight := int(float64(bounds.Dy()) * scale)
-
-	// Resize
-	draw.ApproxBiLinear.Scale(newImg, image.Rect(0, 0, newWidth, newHeight), img, bounds, draw.Over, nil)
-
-	return newImg
-}
-
-func saveBytesToDisk(data []byte, filename string) error {
-	out, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-	_, err = out.Write(data)
-	return err
-}
-
 func saveImageToDisk(img image.Image, filename string) error {
 	out, err := os.Create(filename)
 	if err != nil {
@@ -444,6 +570,17 @@ func saveImageToDisk(img image.Image, filename string) error {
 	return png.Encode(out, img)
 }
 
+// sanitizeFilenameComponent strips path separators and traversal segments
+// from s so it's safe to use as a single filename component, such as
+// "../../etc/passwd" or an absolute path smuggled in through s.
+func sanitizeFilenameComponent(s string) string {
+	s = filepath.Base(filepath.Clean(s))
+	if s == "" || s == "." || s == ".." || s == string(filepath.Separator) {
+		return "image"
+	}
+	return s
+}
+
 func saveResultToDisk(result Result, filename string) error {
 	out, err := os.Create(filename)
 	if err != nil {
@@ -0,0 +1,187 @@
+// Package mediapipe normalizes arbitrary image/video inputs (WebP, APNG,
+// MP4, WebM, HEIC, ...) down to the PNG/GIF containers the rest of
+// image-categorizer already knows how to decode and resize.
+//
+// It shells out to the system `ffprobe` and `ffmpeg` binaries rather than
+// embedding a WASM build of ffmpeg; a wazero-based in-process runtime (e.g.
+// go-ffmpreg) would drop the external binary dependency and is a natural
+// drop-in behind this same Pipeline interface, but isn't wired up here.
+package mediapipe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Format is a normalized output container.
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatGIF Format = "gif"
+)
+
+// Decoded is the result of normalizing a source file.
+type Decoded struct {
+	Data     []byte
+	Format   Format
+	Animated bool
+}
+
+// Pipeline probes and transcodes media through ffprobe/ffmpeg, limiting how
+// many ffmpeg processes may run at once.
+type Pipeline struct {
+	sem chan struct{}
+}
+
+// New returns a Pipeline that allows at most maxConcurrent simultaneous
+// ffmpeg invocations. maxConcurrent <= 0 is treated as 1.
+func New(maxConcurrent int) *Pipeline {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return &Pipeline{sem: make(chan struct{}, maxConcurrent)}
+}
+
+func (p *Pipeline) acquire() { p.sem <- struct{}{} }
+func (p *Pipeline) release() { <-p.sem }
+
+type probeResult struct {
+	CodecName    string `json:"codec_name"`
+	NbFrames     string `json:"nb_frames"`
+	NbReadFrames string `json:"nb_read_frames"`
+}
+
+type probeOutput struct {
+	Streams []probeResult `json:"streams"`
+}
+
+// probe inspects the first video stream of path using ffprobe. It passes
+// -count_frames so nb_read_frames is populated even for containers (animated
+// WebP, APNG, WebM) whose metadata doesn't carry a frame count in nb_frames
+// -- those commonly report nb_frames as "N/A", and trusting that alone would
+// misdetect an animated source as a single still frame. -count_frames forces
+// ffprobe to fully decode the stream, which costs more than a metadata-only
+// probe but is the only reliable way to get a frame count for these formats.
+func (p *Pipeline) probe(ctx context.Context, path string) (*probeResult, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-count_frames",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,nb_frames,nb_read_frames",
+		"-of", "json",
+		path,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe %s: %w: %s", path, err, stderr.String())
+	}
+
+	var out probeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("ffprobe %s: parsing output: %w", path, err)
+	}
+	if len(out.Streams) == 0 {
+		return nil, fmt.Errorf("ffprobe %s: no video stream found", path)
+	}
+	return &out.Streams[0], nil
+}
+
+// frameCount picks whichever of nb_frames/nb_read_frames ffprobe actually
+// populated, preferring nb_read_frames (from -count_frames) since nb_frames
+// is frequently "N/A" for animated WebP, APNG, and WebM containers.
+func (r *probeResult) frameCount() string {
+	if isKnownFrameCount(r.NbReadFrames) {
+		return r.NbReadFrames
+	}
+	return r.NbFrames
+}
+
+func isKnownFrameCount(s string) bool {
+	return s != "" && s != "N/A"
+}
+
+// nativelyDecodable formats are already understood by image/png, image/jpeg,
+// and image/gif, so they're read straight off disk without invoking ffmpeg.
+var nativelyDecodable = map[string]Format{
+	"mjpeg": FormatPNG,
+	"png":   FormatPNG,
+}
+
+// Decode normalizes path into either a static PNG or an animated GIF,
+// transcoding via ffmpeg when the source format isn't one Go's standard
+// image decoders already handle (WebP, APNG, MP4, WebM, HEIC, ...).
+func (p *Pipeline) Decode(ctx context.Context, path string) (*Decoded, error) {
+	info, err := p.probe(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := info.frameCount()
+	animated := isKnownFrameCount(frames) && frames != "1"
+
+	if info.CodecName == "gif" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Decoded{Data: data, Format: FormatGIF, Animated: true}, nil
+	}
+
+	if target, ok := nativelyDecodable[info.CodecName]; ok && !animated {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Decoded{Data: data, Format: target, Animated: false}, nil
+	}
+
+	if animated {
+		return p.transcode(ctx, path, FormatGIF)
+	}
+	return p.transcode(ctx, path, FormatPNG)
+}
+
+// transcode invokes ffmpeg to re-encode path into the given format, gated by
+// the pipeline's concurrency semaphore so CPU-bound transcodes can't starve
+// the machine independently of the OpenAI API concurrency limit.
+func (p *Pipeline) transcode(ctx context.Context, path string, format Format) (*Decoded, error) {
+	p.acquire()
+	defer p.release()
+
+	tmp, err := os.CreateTemp("", "mediapipe-*."+string(format))
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpName)
+
+	args := []string{"-y", "-i", path}
+	switch format {
+	case FormatGIF:
+		args = append(args, "-vf", "split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse")
+	case FormatPNG:
+		args = append(args, "-frames:v", "1")
+	}
+	args = append(args, tmpName)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg transcode %s to %s: %w: %s", path, format, err, stderr.String())
+	}
+
+	data, err := os.ReadFile(tmpName)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoded{Data: data, Format: format, Animated: format == FormatGIF}, nil
+}
@@ -0,0 +1,56 @@
+package mediapipe
+
+import "testing"
+
+// These cases are drawn from how ffprobe actually reports nb_frames/
+// nb_read_frames for the formats Decode needs to tell apart: nb_frames is
+// frequently "N/A" for animated WebP, APNG, and WebM containers, which is
+// why frameCount prefers nb_read_frames (populated via -count_frames) when
+// it's available.
+func TestProbeResultFrameCount(t *testing.T) {
+	tests := []struct {
+		name string
+		r    probeResult
+		want string
+	}{
+		{"static png", probeResult{NbFrames: "1", NbReadFrames: "1"}, "1"},
+		{"gif with known nb_frames", probeResult{NbFrames: "24", NbReadFrames: "24"}, "24"},
+		{"animated webp, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "12"}, "12"},
+		{"apng, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "8"}, "8"},
+		{"webm, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "300"}, "300"},
+		{"neither populated", probeResult{NbFrames: "N/A", NbReadFrames: "N/A"}, "N/A"},
+		{"both empty", probeResult{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.frameCount(); got != tt.want {
+				t.Errorf("frameCount() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnimatedDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		r    probeResult
+		want bool
+	}{
+		{"static png", probeResult{NbFrames: "1", NbReadFrames: "1"}, false},
+		{"gif with known nb_frames", probeResult{NbFrames: "24", NbReadFrames: "24"}, true},
+		{"animated webp, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "12"}, true},
+		{"apng, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "8"}, true},
+		{"webm, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "300"}, true},
+		{"single-frame webp, nb_frames unknown", probeResult{NbFrames: "N/A", NbReadFrames: "1"}, false},
+		{"neither populated", probeResult{NbFrames: "N/A", NbReadFrames: "N/A"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := tt.r.frameCount()
+			animated := isKnownFrameCount(frames) && frames != "1"
+			if animated != tt.want {
+				t.Errorf("animated = %v, want %v (frameCount %q)", animated, tt.want, frames)
+			}
+		})
+	}
+}
@@ -1,4 +1,6 @@
-package main
+// Package ratelimit provides a simple per-minute token-bucket rate limiter,
+// used to cap outbound request rates independently per backend.
+package ratelimit
 
 import (
 	"time"
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// serveAddr is the address `serve` listens on.
+var serveAddr = mustGetEnvString("SERVE_ADDR", ":8080")
+
+// serveUploadMaxBytes caps the multipart body POST /categorize will read
+// into memory before spilling to a temp file, and (via http.MaxBytesReader)
+// the total size of the request body a caller may send at all.
+var serveUploadMaxBytes = int64(mustGetEnvInt("SERVE_UPLOAD_MAX_MB", 32)) << 20
+
+// serveReadHeaderTimeout/serveReadTimeout bound how long a client may take
+// to send request headers/body, so a slow or stalled connection can't tie
+// up a listener goroutine indefinitely. There's no WriteTimeout: it would
+// also cap GET /jobs/{id}/events, whose SSE stream is meant to stay open
+// for as long as a job takes.
+var serveReadHeaderTimeout = time.Duration(mustGetEnvInt("SERVE_READ_HEADER_TIMEOUT_SECONDS", 10)) * time.Second
+var serveReadTimeout = time.Duration(mustGetEnvInt("SERVE_READ_TIMEOUT_SECONDS", 60)) * time.Second
+
+// serveJobTimeout bounds how long a single job's decode/categorize/save
+// pipeline may run before its context is canceled. Without this, a crafted
+// upload that makes ffmpeg hang, or a stalled vision API call, would wedge
+// a processingSem slot (sized 1 by default) forever.
+var serveJobTimeout = time.Duration(mustGetEnvInt("SERVE_JOB_TIMEOUT_SECONDS", 120)) * time.Second
+
+// job tracks one POST /categorize request through decoding, resizing,
+// categorization, and saving, so GET /jobs/{id} and GET /jobs/{id}/events
+// can report on it while it runs.
+type job struct {
+	id string
+
+	mu     sync.Mutex
+	result Result
+	done   bool
+	events []string
+	subs   map[chan string]struct{}
+}
+
+// progress records stage on the job and broadcasts it to any open
+// GET /jobs/{id}/events subscribers.
+func (j *job) progress(stage string) {
+	j.mu.Lock()
+	j.events = append(j.events, stage)
+	subs := make([]chan string, 0, len(j.subs))
+	for ch := range j.subs {
+		subs = append(subs, ch)
+	}
+	j.mu.Unlock()
+
+	for _, ch := range subs {
+		ch <- stage
+	}
+}
+
+// subscribe returns a channel of future progress stages plus the stages
+// already seen, and an unsubscribe func the caller must run when done.
+func (j *job) subscribe() (ch chan string, replayed []string, unsubscribe func()) {
+	ch = make(chan string, 16)
+
+	j.mu.Lock()
+	replayed = append([]string(nil), j.events...)
+	if j.subs == nil {
+		j.subs = make(map[chan string]struct{})
+	}
+	j.subs[ch] = struct{}{}
+	j.mu.Unlock()
+
+	return ch, replayed, func() {
+		j.mu.Lock()
+		delete(j.subs, ch)
+		j.mu.Unlock()
+	}
+}
+
+func (j *job) finish(result Result) {
+	j.mu.Lock()
+	j.result = result
+	j.done = true
+	j.mu.Unlock()
+}
+
+func (j *job) snapshot() (result Result, done bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result, j.done
+}
+
+var jobs sync.Map // map[string]*job
+
+func newJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// serve runs image-categorizer as an HTTP API instead of a CLI: uploads
+// submitted to POST /categorize go through the same decode/resize/
+// categorize/save pipeline as the CLI, gated by the same processingSem job
+// queue, with progress reported over SSE and results served back as URLs
+// under GET /jobs/{id}/files/.
+func serve() {
+	storage := newLocalStorage(workingDirOrDot())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /categorize", handleCategorize(storage))
+	mux.HandleFunc("GET /jobs/{id}", handleJobStatus)
+	mux.HandleFunc("GET /jobs/{id}/events", handleJobEvents)
+	mux.HandleFunc("GET /jobs/{id}/files/{file}", handleJobFile(storage))
+
+	server := &http.Server{
+		Addr:              serveAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+	}
+
+	fmt.Printf("image-categorizer: serving on %s\n", serveAddr)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func handleCategorize(storage Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// ParseMultipartForm only limits what it buffers in memory before
+		// spilling to disk; MaxBytesReader caps the total body a caller may
+		// send at all, closing the connection once the limit is exceeded.
+		r.Body = http.MaxBytesReader(w, r.Body, serveUploadMaxBytes)
+
+		if err := r.ParseMultipartForm(serveUploadMaxBytes); err != nil {
+			http.Error(w, fmt.Sprintf("parsing upload: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading \"image\" field: %s", err), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		id := newJobID()
+		j := &job{id: id}
+		jobs.Store(id, j)
+
+		// Read the upload into memory now, while the request body is
+		// still available; doProcessImage runs after we've responded.
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading upload: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		go runJob(j, header.Filename, data, storage)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+	}
+}
+
+// runJob processes an uploaded image through the normal pipeline, then
+// relocates its saved files into storage under the job's own namespace and
+// rewrites DestinationFiles to the URLs they're served back at.
+func runJob(j *job, filename string, data []byte, storage Storage) {
+	processingSem <- struct{}{}
+	defer func() { <-processingSem }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), serveJobTimeout)
+	defer cancel()
+
+	result := doProcessImage(ctx, filename, bytes.NewReader(data), j.progress)
+	if result.Error == nil {
+		for i, destFile := range result.DestinationFiles {
+			if err := storage.Adopt(j.id, destFile); err != nil {
+				result.Error = err
+				break
+			}
+			result.DestinationFiles[i] = fmt.Sprintf("/jobs/%s/files/%s", j.id, destFile)
+		}
+	}
+
+	if result.Error != nil {
+		// Wake up any handleJobEvents subscriber blocked on <-ch: without a
+		// terminal stage, a client subscribed before a failure would hang
+		// forever, since doProcessImage's own progress calls stop wherever
+		// it bailed out.
+		j.progress("error")
+	}
+
+	j.finish(result)
+}
+
+func handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	j, ok := lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	result, _ := j.snapshot()
+	if result.Error != nil {
+		result.ErrorString = result.Error.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	j, ok := lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, replayed, unsubscribe := j.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for _, stage := range replayed {
+		fmt.Fprintf(w, "data: %s\n\n", stage)
+	}
+	flusher.Flush()
+
+	if _, done := j.snapshot(); done {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case stage, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", stage)
+			flusher.Flush()
+			if stage == "saved" || stage == "error" {
+				return
+			}
+		}
+	}
+}
+
+func handleJobFile(storage Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := lookupJob(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := storage.Open(j.id, r.PathValue("file"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer data.Close()
+
+		io.Copy(w, data)
+	}
+}
+
+func lookupJob(w http.ResponseWriter, r *http.Request) (*job, bool) {
+	v, ok := jobs.Load(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return v.(*job), true
+}
+
+func workingDirOrDot() string {
+	if workingDir == "" {
+		return "."
+	}
+	return workingDir
+}
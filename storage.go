@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Storage is where `serve` keeps each job's saved output files, behind the
+// URLs it hands back in DestinationFiles. localStorage is the only
+// implementation wired up; an S3-backed Storage (for running image-
+// categorizer without a persistent local disk) is a natural addition
+// behind the same interface, but isn't implemented here.
+type Storage interface {
+	// Adopt moves filename (already written to the current directory by
+	// doProcessImage) into storage under jobID's namespace.
+	Adopt(jobID, filename string) error
+	// Open returns filename's contents from jobID's namespace.
+	Open(jobID, filename string) (io.ReadCloser, error)
+}
+
+// localStorage keeps each job's files in dir/jobs/{jobID}/.
+type localStorage struct {
+	dir string
+}
+
+func newLocalStorage(dir string) *localStorage {
+	return &localStorage{dir: dir}
+}
+
+func (s *localStorage) jobDir(jobID string) string {
+	return filepath.Join(s.dir, "jobs", jobID)
+}
+
+func (s *localStorage) Adopt(jobID, filename string) error {
+	if filename == "" || filename == "." || filename == ".." || filepath.Base(filename) != filename {
+		return fmt.Errorf("storage: invalid filename %q", filename)
+	}
+
+	jobDir := s.jobDir(jobID)
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(filename, filepath.Join(jobDir, filename))
+}
+
+func (s *localStorage) Open(jobID, filename string) (io.ReadCloser, error) {
+	if filename == "" || filename == "." || filename == ".." || filepath.Base(filename) != filename {
+		return nil, fmt.Errorf("storage: invalid filename %q", filename)
+	}
+	return os.Open(filepath.Join(s.jobDir(jobID), filename))
+}
@@ -19,8 +19,19 @@ type Response struct {
 
 type Result struct {
 	Response
-	SourceFilepath   string   `json:"source,omitempty"`
-	DestinationFiles []string `json:"destination,omitempty"`
-	Error            error    `json:"-"`
-	ErrorString      string   `json:"error,omitempty"`
+	SourceFilepath   string               `json:"source,omitempty"`
+	DestinationFiles []string             `json:"destination,omitempty"`
+	SizeBudgets      map[string]FitResult `json:"sizeBudgets,omitempty"`
+	Cached           bool                 `json:"cached,omitempty"`
+	Error            error                `json:"-"`
+	ErrorString      string               `json:"error,omitempty"`
+}
+
+// FitResult reports how fitBudget reduced an encoded image to fit its
+// per-size byte budget, for a single target size.
+type FitResult struct {
+	Bytes      int    `json:"bytes"`
+	Budget     int    `json:"budget"`
+	Strategy   string `json:"strategy"`
+	FitsBudget bool   `json:"fitsBudget"`
 }
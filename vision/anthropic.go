@@ -0,0 +1,156 @@
+package vision
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+
+	"github.com/emmaly/image-categorizer/ratelimit"
+)
+
+const anthropicAPIVersion = "2023-06-01"
+
+// AnthropicCategorizer talks to the Anthropic Messages API, forcing a single
+// tool_use block whose input matches schema.
+type AnthropicCategorizer struct {
+	apiKey    string
+	model     string
+	maxTokens int
+	limiter   *ratelimit.Limiter
+	client    *http.Client
+}
+
+func NewAnthropic(apiKey, model string, maxTokens int, limiter *ratelimit.Limiter) *AnthropicCategorizer {
+	return &AnthropicCategorizer{
+		apiKey:    apiKey,
+		model:     model,
+		maxTokens: maxTokens,
+		limiter:   limiter,
+		client:    &http.Client{},
+	}
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicContentBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema *jsonschema.Definition `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicRequest struct {
+	Model      string              `json:"model"`
+	MaxTokens  int                 `json:"max_tokens"`
+	Messages   []anthropicMessage  `json:"messages"`
+	Tools      []anthropicTool     `json:"tools"`
+	ToolChoice anthropicToolChoice `json:"tool_choice"`
+}
+
+type anthropicResponseBlock struct {
+	Type  string          `json:"type"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+type anthropicErrorBody struct {
+	Message string `json:"message"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicResponseBlock `json:"content"`
+	Error   *anthropicErrorBody      `json:"error"`
+}
+
+func (c *AnthropicCategorizer) Categorize(ctx context.Context, images []Image, prompt string, schema *jsonschema.Definition) (json.RawMessage, error) {
+	c.limiter.Wait()
+
+	content := []anthropicContentBlock{{Type: "text", Text: prompt}}
+	for _, img := range images {
+		content = append(content, anthropicContentBlock{
+			Type: "image",
+			Source: &anthropicImageSource{
+				Type:      "base64",
+				MediaType: img.MIMEType,
+				Data:      base64.StdEncoding.EncodeToString(img.Data),
+			},
+		})
+	}
+
+	reqBody := anthropicRequest{
+		Model:     c.model,
+		MaxTokens: c.maxTokens,
+		Messages:  []anthropicMessage{{Role: "user", Content: content}},
+		Tools: []anthropicTool{{
+			Name:        "response",
+			Description: "Return the results in a structured format",
+			InputSchema: schema,
+		}},
+		ToolChoice: anthropicToolChoice{Type: "tool", Name: "response"},
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("anthropic: parsing response: %w", err)
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("anthropic: %s", parsed.Error.Message)
+	}
+
+	for _, block := range parsed.Content {
+		if block.Type == "tool_use" && block.Name == "response" {
+			return block.Input, nil
+		}
+	}
+
+	return nil, fmt.Errorf("anthropic: no tool_use block found in response")
+}
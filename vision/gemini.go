@@ -0,0 +1,160 @@
+package vision
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+
+	"github.com/emmaly/image-categorizer/ratelimit"
+)
+
+// GeminiCategorizer talks to Google's Gemini generateContent REST API,
+// forcing a single function call whose args match schema.
+type GeminiCategorizer struct {
+	apiKey  string
+	model   string
+	limiter *ratelimit.Limiter
+	client  *http.Client
+}
+
+func NewGemini(apiKey, model string, limiter *ratelimit.Limiter) *GeminiCategorizer {
+	return &GeminiCategorizer{apiKey: apiKey, model: model, limiter: limiter, client: &http.Client{}}
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *geminiInlineData `json:"inline_data,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  *jsonschema.Definition `json:"parameters"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiRequest struct {
+	Contents   []geminiContent  `json:"contents"`
+	Tools      []geminiTool     `json:"tools"`
+	ToolConfig geminiToolConfig `json:"toolConfig"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+type geminiResponsePart struct {
+	FunctionCall *geminiFunctionCall `json:"functionCall"`
+}
+
+type geminiCandidateContent struct {
+	Parts []geminiResponsePart `json:"parts"`
+}
+
+type geminiCandidate struct {
+	Content geminiCandidateContent `json:"content"`
+}
+
+type geminiErrorBody struct {
+	Message string `json:"message"`
+}
+
+type geminiResponse struct {
+	Candidates []geminiCandidate `json:"candidates"`
+	Error      *geminiErrorBody  `json:"error"`
+}
+
+func (c *GeminiCategorizer) Categorize(ctx context.Context, images []Image, prompt string, schema *jsonschema.Definition) (json.RawMessage, error) {
+	c.limiter.Wait()
+
+	parts := []geminiPart{{Text: prompt}}
+	for _, img := range images {
+		parts = append(parts, geminiPart{InlineData: &geminiInlineData{
+			MimeType: img.MIMEType,
+			Data:     base64.StdEncoding.EncodeToString(img.Data),
+		}})
+	}
+
+	reqBody := geminiRequest{
+		Contents: []geminiContent{{Role: "user", Parts: parts}},
+		Tools: []geminiTool{{FunctionDeclarations: []geminiFunctionDeclaration{{
+			Name:        "response",
+			Description: "Return the results in a structured format",
+			Parameters:  schema,
+		}}}},
+		ToolConfig: geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{
+			Mode:                 "ANY",
+			AllowedFunctionNames: []string{"response"},
+		}},
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", c.model, c.apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed geminiResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("gemini: parsing response: %w", err)
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("gemini: %s", parsed.Error.Message)
+	}
+
+	for _, candidate := range parsed.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil && part.FunctionCall.Name == "response" {
+				return part.FunctionCall.Args, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("gemini: no function call found in response")
+}
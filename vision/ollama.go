@@ -0,0 +1,109 @@
+package vision
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+
+	"github.com/emmaly/image-categorizer/ratelimit"
+)
+
+// OllamaCategorizer talks to a local Ollama (or llama.cpp-compatible) server
+// running a vision model such as LLaVA or Qwen-VL. Ollama's /api/chat format
+// parameter accepts a JSON schema directly, but local vision models don't
+// reliably honor it, so the schema is also restated in the prompt as a shim;
+// the caller is still responsible for validating the result against schema.
+type OllamaCategorizer struct {
+	host    string
+	model   string
+	limiter *ratelimit.Limiter
+	client  *http.Client
+}
+
+func NewOllama(host, model string, limiter *ratelimit.Limiter) *OllamaCategorizer {
+	return &OllamaCategorizer{host: strings.TrimRight(host, "/"), model: model, limiter: limiter, client: &http.Client{}}
+}
+
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Format   *jsonschema.Definition `json:"format,omitempty"`
+	Stream   bool                   `json:"stream"`
+}
+
+type ollamaResponseMessage struct {
+	Content string `json:"content"`
+}
+
+type ollamaResponse struct {
+	Message ollamaResponseMessage `json:"message"`
+	Error   string                `json:"error"`
+}
+
+func (c *OllamaCategorizer) Categorize(ctx context.Context, images []Image, prompt string, schema *jsonschema.Definition) (json.RawMessage, error) {
+	c.limiter.Wait()
+
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedImages := make([]string, len(images))
+	for i, img := range images {
+		encodedImages[i] = base64.StdEncoding.EncodeToString(img.Data)
+	}
+
+	shimmedPrompt := fmt.Sprintf("%s\n\nRespond with ONLY a single JSON object matching this JSON Schema, no prose, no markdown fences:\n%s", prompt, schemaJSON)
+
+	reqBody := ollamaRequest{
+		Model:    c.model,
+		Messages: []ollamaMessage{{Role: "user", Content: shimmedPrompt, Images: encodedImages}},
+		Format:   schema,
+		Stream:   false,
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed ollamaResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("ollama: parsing response: %w", err)
+	}
+	if parsed.Error != "" {
+		return nil, fmt.Errorf("ollama: %s", parsed.Error)
+	}
+
+	return json.RawMessage(parsed.Message.Content), nil
+}
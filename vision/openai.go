@@ -0,0 +1,94 @@
+package vision
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+
+	"github.com/emmaly/image-categorizer/ratelimit"
+)
+
+// dataURIBufPool recycles the *bytes.Buffer used to base64-encode an image
+// into a data URI, the one place this backend genuinely needs the whole
+// image in memory a second time (as a string) rather than as raw bytes.
+var dataURIBufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// OpenAICategorizer is the original backend: OpenAI chat completions with a
+// single forced tool call.
+type OpenAICategorizer struct {
+	client  *openai.Client
+	model   string
+	limiter *ratelimit.Limiter
+}
+
+func NewOpenAI(client *openai.Client, model string, limiter *ratelimit.Limiter) *OpenAICategorizer {
+	return &OpenAICategorizer{client: client, model: model, limiter: limiter}
+}
+
+func (c *OpenAICategorizer) Categorize(ctx context.Context, images []Image, prompt string, schema *jsonschema.Definition) (json.RawMessage, error) {
+	c.limiter.Wait()
+
+	messageParts := []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: prompt},
+	}
+	for _, img := range images {
+		messageParts = append(messageParts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL: imageToDataURI(img),
+			},
+		})
+	}
+
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, MultiContent: messageParts},
+		},
+		Tools: []openai.Tool{
+			{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        "response",
+					Description: "Return the results in a structured format",
+					Parameters:  schema,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("openai: no response received")
+	}
+	if len(resp.Choices[0].Message.ToolCalls) == 0 {
+		return nil, fmt.Errorf("openai: no tool calls found")
+	}
+
+	return json.RawMessage(resp.Choices[0].Message.ToolCalls[0].Function.Arguments), nil
+}
+
+func imageToDataURI(img Image) string {
+	buf := dataURIBufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer dataURIBufPool.Put(buf)
+
+	buf.WriteString("data:")
+	buf.WriteString(img.MIMEType)
+	buf.WriteString(";base64,")
+
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	enc.Write(img.Data)
+	enc.Close()
+
+	return buf.String()
+}
@@ -0,0 +1,27 @@
+// Package vision abstracts the vision-capable chat model that
+// image-categorizer sends emote images to, so the caller isn't hardwired to
+// OpenAI. Every backend is handed the same prompt and the same
+// jsonschema.Definition contract (image-categorizer's Response shape) and is
+// expected to return JSON matching it.
+package vision
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// Image is a single image to hand to the model, in whatever order the
+// caller wants the model to consider them (image-categorizer sends the
+// original image followed by the 28x28 render).
+type Image struct {
+	MIMEType string
+	Data     []byte
+}
+
+// Categorizer sends images and a prompt to a vision-capable model and
+// returns its structured response as raw JSON matching schema.
+type Categorizer interface {
+	Categorize(ctx context.Context, images []Image, prompt string, schema *jsonschema.Definition) (json.RawMessage, error)
+}